@@ -1,4 +1,4 @@
-// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+// Copyright (c) 2016-2018 Tigera, Inc. All rights reserved.
 
 // Licensed under the Apache License, Version 2.0 (the "License");
 // you may not use this file except in compliance with the License.
@@ -25,7 +25,6 @@ import (
 
 	"github.com/projectcalico/calicoctl/calicoctl/commands/argutils"
 	"github.com/projectcalico/calicoctl/calicoctl/commands/constants"
-	"github.com/projectcalico/calicoctl/calicoctl/commands/v1resourceloader"
 	"github.com/projectcalico/libcalico-go/lib/apis/v1/unversioned"
 	conversion "github.com/projectcalico/libcalico-go/lib/upgrade/etcd/conversionv1v3"
 )
@@ -33,7 +32,10 @@ import (
 func Convert(args []string) {
 	doc := constants.DatastoreIntro + `Usage:
   calicoctl convert --filename=<FILENAME>
-                [--output=<OUTPUT>]
+                [--output=<OUTPUT>] [-R]
+                [--from=<FROM>] [--to=<TO>]
+                [--output-dir=<DIR> | --in-place]
+                [--validate [--strict]] [--explain]
 
 Examples:
   # Create a policy using the data in policy.yaml.
@@ -42,18 +44,66 @@ Examples:
   # Create a policy based on the JSON passed into stdin.
   cat policy.json | calicoctl convert -f -
 
+  # Convert every manifest in a directory, fetched from a gist.
+  calicoctl convert -f gist:abcdef1234567890 -R
+
+  # Downgrade a v3 manifest back to v1 for an older calico deployment.
+  calicoctl convert -f ./policy.v3.yaml --from=v3 --to=v1
+
+  # Convert a tree of v1 manifests, writing one file per resource.
+  calicoctl convert -f ./v1-manifests -R --output-dir=./v3-manifests
+
+  # Convert a tree of v1 manifests in place, alongside the originals.
+  calicoctl convert -f ./v1-manifests -R --in-place
+
+  # Check that a v1 manifest survives the round trip to v3 and back.
+  calicoctl convert -f ./policy.yaml --validate --strict
+
 Options:
   -h --help                     Show this screen.
   -f --filename=<FILENAME>      Filename to use to create the resource.  If set to
-                                "-" loads from stdin.
+                                "-" loads from stdin.  In addition to a local
+                                path, FILENAME may be a directory, a plain
+                                https:// URL, a "gist:<id>" or
+                                https://gist.github.com/... URL, or a
+                                "git+https://host/org/repo.git//path?ref=branch"
+                                reference; remote manifests are fetched before
+                                conversion.
+  -R --recursive                 When FILENAME is a directory (local or
+                                fetched), recurse into subdirectories
+                                collecting *.yaml/*.yml/*.json files.
   -o --output=<OUTPUT FORMAT>   Output format. One of: yaml or json.
                                 [Default: yaml]
+     --from=<FROM>              API version of the input resource(s). One of:
+                                v1 or v3. [Default: v1]
+     --to=<TO>                  API version to convert the input resource(s)
+                                to. One of: v1 or v3. [Default: v3]
+     --output-dir=<DIR>         Write each converted resource to
+                                <DIR>/<namespace>/<kind>-<name>.<ext>,
+                                preserving FILENAME's relative directory
+                                layout, instead of printing a combined stream
+                                to stdout.
+     --in-place                 Rewrite each input file next to itself with
+                                a ".v3.yaml" (or ".v3.json") suffix, instead
+                                of printing a combined stream to stdout.
+     --validate                 Convert each v1 resource to v3 and back again,
+                                reporting any fields that were dropped,
+                                renamed, or defaulted in the round trip,
+                                instead of printing the converted resources.
+     --strict                   With --validate, exit non-zero if any field
+                                loss is detected.
+     --explain                  Annotate each converted resource with the v1
+                                source fields it was converted from.
 
 
 Description:
   Convert config files between different API versions. Both YAML and JSON formats are accepted.
 
   The default output will be printed to stdout in YAML format.
+
+  Resource kinds that calicoctl doesn't know how to convert natively are
+  handed off to a calicoctl-convert-<kind> executable on $PATH, if one is
+  installed, in the same way kubectl resolves its own plugins.
 `
 	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
 	if err != nil {
@@ -82,10 +132,121 @@ Description:
 	}
 
 	filename := argutils.ArgStringOrBlank(parsedArgs, "--filename")
+	recursive := parsedArgs["--recursive"].(bool)
+	from := parsedArgs["--from"].(string)
+	to := parsedArgs["--to"].(string)
+	outputDir := argutils.ArgStringOrBlank(parsedArgs, "--output-dir")
+	inPlace := parsedArgs["--in-place"].(bool)
+	validate := parsedArgs["--validate"].(bool)
+	strict := parsedArgs["--strict"].(bool)
+	explain := parsedArgs["--explain"].(bool)
+
+	if outputDir != "" && inPlace {
+		fmt.Println("Failed to execute command: --output-dir and --in-place are mutually exclusive")
+		os.Exit(1)
+	}
+	if (validate || explain) && (outputDir != "" || inPlace) {
+		fmt.Println("Failed to execute command: --validate and --explain are not supported with --output-dir or --in-place")
+		os.Exit(1)
+	}
+	if from != "v1" && (validate || explain) {
+		fmt.Println("Failed to execute command: --validate and --explain require --from=v1")
+		os.Exit(1)
+	}
+	if validate && explain {
+		fmt.Println("Failed to execute command: --validate and --explain are mutually exclusive")
+		os.Exit(1)
+	}
+
+	switch {
+	case from == "v1" && to == "v3" && validate:
+		validateV1ToV3(filename, recursive, output, strict)
+	case from == "v1" && to == "v3" && explain:
+		explainV1ToV3(filename, recursive, output)
+	case from == "v1" && to == "v3":
+		convertV1ToV3(filename, recursive, output, rp, outputDir, inPlace)
+	case from == "v3" && to == "v1":
+		convertV3ToV1(filename, recursive, output)
+	default:
+		fmt.Printf("Failed to execute command: unsupported conversion from '%s' to '%s'\n", from, to)
+		os.Exit(1)
+	}
+}
 
-	// Load the V1 resource from file and convert to a slice
-	// of resources for easier handling.
-	resV1, err := v1resourceloader.CreateResourcesFromFile(filename)
+// validateV1ToV3 converts each v1 resource referenced by filename to v3 and
+// back again, printing a report of any fields that didn't survive the round
+// trip.  With strict set, the command exits non-zero if any loss is found.
+func validateV1ToV3(filename string, recursive bool, output string, strict bool) {
+	resV1, err := loadV1Resources(filename, recursive)
+	if err != nil {
+		fmt.Printf("Failed to execute command: %v\n", err)
+		os.Exit(1)
+	}
+
+	var results []validationResult
+	for _, v1Resource := range resV1 {
+		v3Resource, err := convertResource(v1Resource)
+		if err != nil {
+			fmt.Printf("Failed to execute command: %v\n", err)
+			os.Exit(1)
+		}
+		result, err := validateRoundTrip(v1Resource, v3Resource)
+		if err != nil {
+			fmt.Printf("Failed to execute command: %v\n", err)
+			os.Exit(1)
+		}
+		results = append(results, result)
+	}
+
+	if err := printValidationReport(output, results); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if strict && hasLoss(results) {
+		os.Exit(1)
+	}
+}
+
+// explainV1ToV3 converts each v1 resource referenced by filename to v3,
+// printing each result annotated with the v1 source fields it came from.
+func explainV1ToV3(filename string, recursive bool, output string) {
+	resV1, err := loadV1Resources(filename, recursive)
+	if err != nil {
+		fmt.Printf("Failed to execute command: %v\n", err)
+		os.Exit(1)
+	}
+
+	var explained []explainedResource
+	for _, v1Resource := range resV1 {
+		v3Resource, err := convertResource(v1Resource)
+		if err != nil {
+			fmt.Printf("Failed to execute command: %v\n", err)
+			os.Exit(1)
+		}
+		before, err := toGenericMap(v1Resource)
+		if err != nil {
+			fmt.Printf("Failed to execute command: %v\n", err)
+			os.Exit(1)
+		}
+		explained = append(explained, explainedResource{Resource: v3Resource, V1Sources: flattenPaths(before)})
+	}
+
+	if err := printExplainedResources(output, explained); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// convertV1ToV3 loads the v1 resource(s) referenced by filename and converts
+// each to its v3 equivalent.  With outputDir or inPlace set, the converted
+// resources are written to files instead of being printed via rp.
+func convertV1ToV3(filename string, recursive bool, output string, rp resourcePrinter, outputDir string, inPlace bool) {
+	if outputDir != "" || inPlace {
+		convertV1ToV3Split(filename, recursive, output, outputDir, inPlace)
+		return
+	}
+
+	resV1, err := loadV1Resources(filename, recursive)
 	if err != nil {
 		fmt.Printf("Failed to execute command: %v\n", err)
 		os.Exit(1)
@@ -103,32 +264,81 @@ Description:
 
 	log.Infof("results: %+v", results)
 
-	err = rp.print(nil, results)
+	if err := rp.print(nil, results); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// convertV1ToV3Split loads the v1 resource(s) referenced by filename,
+// keeping track of which source file each came from, converts each to its
+// v3 equivalent, and writes the results to outputDir or back in place.
+func convertV1ToV3Split(filename string, recursive bool, output, outputDir string, inPlace bool) {
+	grouped, _, err := loadV1ResourcesByFile(filename, recursive)
+	if err != nil {
+		fmt.Printf("Failed to execute command: %v\n", err)
+		os.Exit(1)
+	}
+
+	resultsByPath := map[string][]runtime.Object{}
+	for _, fr := range grouped {
+		for _, v1Resource := range fr.resources {
+			v3Resource, err := convertResource(v1Resource)
+			if err != nil {
+				fmt.Printf("Failed to execute command: %v\n", err)
+				os.Exit(1)
+			}
+			resultsByPath[fr.path] = append(resultsByPath[fr.path], v3Resource)
+		}
+	}
+
+	var writeErr error
+	if inPlace {
+		writeErr = writeInPlace(output, grouped, resultsByPath)
+	} else {
+		writeErr = writeOutputDir(outputDir, output, grouped, resultsByPath)
+	}
+	if writeErr != nil {
+		fmt.Printf("Failed to execute command: %v\n", writeErr)
+		os.Exit(1)
+	}
+}
+
+// convertV3ToV1 loads the v3 resource(s) referenced by filename, downgrades
+// each to its v1 equivalent, and prints the result in the given format.
+func convertV3ToV1(filename string, recursive bool, output string) {
+	resV3, err := loadV3Resources(filename, recursive)
 	if err != nil {
+		fmt.Printf("Failed to execute command: %v\n", err)
+		os.Exit(1)
+	}
+
+	var results []unversioned.Resource
+	for _, v3Resource := range resV3 {
+		v1Resource, err := convertResourceV3ToV1(v3Resource)
+		if err != nil {
+			fmt.Printf("Failed to execute command: %v\n", err)
+			os.Exit(1)
+		}
+		results = append(results, v1Resource)
+	}
+
+	log.Infof("results: %+v", results)
+
+	if err := printV1Resources(output, results); err != nil {
 		fmt.Println(err)
 	}
 }
 
 func convertResource(v1resource unversioned.Resource) (runtime.Object, error) {
-	switch strings.ToLower(v1resource.GetTypeMetadata().Kind) {
-	case "node":
-		return convert(conversion.Node{}, v1resource)
-	case "hostendpoint":
-		return convert(conversion.HostEndpoint{}, v1resource)
-	case "workloadendpoint":
-		return convert(conversion.WorkloadEndpoint{}, v1resource)
-	case "profile":
-		return convert(conversion.Profile{}, v1resource)
-	case "policy":
-		return convert(conversion.Policy{}, v1resource)
-	case "ippool":
-		return convert(conversion.IPPool{}, v1resource)
-	case "bgppeer":
-		return convert(conversion.BGPPeer{}, v1resource)
-
-	default:
-		return nil, fmt.Errorf("conversion for the resource type '%s' is not supported", v1resource.GetTypeMetadata().Kind)
+	kind := v1resource.GetTypeMetadata().Kind
+	convRes, err := converterForKind(kind)
+	if err != nil {
+		// Not a kind calicoctl knows natively: fall back to an
+		// out-of-process calicoctl-convert-<kind> plugin, if one is
+		// installed on $PATH.
+		return convertViaPlugin(kind, v1resource)
 	}
+	return convert(convRes, v1resource)
 }
 
 func convert(convRes conversion.Converter, v1resource unversioned.Resource) (conversion.Resource, error) {
@@ -0,0 +1,123 @@
+// Copyright (c) 2018 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// writeOutputDir writes the v3 resources converted from each source file to
+// <outputDir>/<relative source directory>/<namespace>/<kind>-<name>.<ext>,
+// mirroring the source tree's relative layout.  Global (non-namespaced)
+// resources are written directly under the relative source directory.
+func writeOutputDir(outputDir, output string, perFile []fileResources, resultsByPath map[string][]runtime.Object) error {
+	for _, fr := range perFile {
+		for _, res := range resultsByPath[fr.path] {
+			dir := filepath.Join(outputDir, filepath.Dir(fr.relPath))
+			if ns := resourceNamespace(res); ns != "" {
+				dir = filepath.Join(dir, ns)
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+
+			name := fmt.Sprintf("%s-%s.%s", strings.ToLower(res.GetObjectKind().GroupVersionKind().Kind), resourceName(res), outputExtension(output))
+			if err := writeResourceFile(filepath.Join(dir, name), output, res); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeInPlace rewrites each source file next to itself with a ".v3.yaml"
+// (or ".v3.json") suffix, containing that file's converted v3 resources.
+func writeInPlace(output string, perFile []fileResources, resultsByPath map[string][]runtime.Object) error {
+	for _, fr := range perFile {
+		results := resultsByPath[fr.path]
+		if len(results) == 0 {
+			continue
+		}
+
+		ext := filepath.Ext(fr.path)
+		outPath := strings.TrimSuffix(fr.path, ext) + ".v3." + outputExtension(output)
+		if err := writeResourceFile(outPath, output, results...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeResourceFile writes resources to path in the given output format, as
+// a single combined YAML document stream or JSON array.
+func writeResourceFile(path, output string, resources ...runtime.Object) error {
+	var out []byte
+	var err error
+	if output == "json" {
+		out, err = json.MarshalIndent(resources, "", "  ")
+	} else {
+		var docs [][]byte
+		for _, res := range resources {
+			doc, err := yaml.Marshal(res)
+			if err != nil {
+				return err
+			}
+			docs = append(docs, doc)
+		}
+		out = []byte(strings.Join(bytesToStrings(docs), "---\n"))
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, out, 0644)
+}
+
+func bytesToStrings(docs [][]byte) []string {
+	strs := make([]string, len(docs))
+	for i, d := range docs {
+		strs[i] = string(d)
+	}
+	return strs
+}
+
+func outputExtension(output string) string {
+	if output == "json" {
+		return "json"
+	}
+	return "yaml"
+}
+
+func resourceNamespace(res runtime.Object) string {
+	if obj, ok := res.(metav1.Object); ok {
+		return obj.GetNamespace()
+	}
+	return ""
+}
+
+func resourceName(res runtime.Object) string {
+	if obj, ok := res.(metav1.Object); ok {
+		return obj.GetName()
+	}
+	return "unknown"
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2018 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func newUnstructured(kind, namespace, name string) runtime.Object {
+	u := &unstructured.Unstructured{}
+	u.SetKind(kind)
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	return u
+}
+
+func TestOutputExtension(t *testing.T) {
+	if got := outputExtension("json"); got != "json" {
+		t.Errorf("outputExtension(\"json\") = %q, want \"json\"", got)
+	}
+	if got := outputExtension("yaml"); got != "yaml" {
+		t.Errorf("outputExtension(\"yaml\") = %q, want \"yaml\"", got)
+	}
+}
+
+func TestResourceNamespaceAndName(t *testing.T) {
+	res := newUnstructured("NetworkPolicy", "kube-system", "allow-dns")
+	if ns := resourceNamespace(res); ns != "kube-system" {
+		t.Errorf("resourceNamespace() = %q, want \"kube-system\"", ns)
+	}
+	if name := resourceName(res); name != "allow-dns" {
+		t.Errorf("resourceName() = %q, want \"allow-dns\"", name)
+	}
+
+	global := newUnstructured("IPPool", "", "pool-1")
+	if ns := resourceNamespace(global); ns != "" {
+		t.Errorf("resourceNamespace() for a global resource = %q, want \"\"", ns)
+	}
+}
+
+func TestWriteOutputDirLayout(t *testing.T) {
+	dir := t.TempDir()
+
+	perFile := []fileResources{{path: "v1/ns1/policy.yaml", relPath: "ns1/policy.yaml"}}
+	results := map[string][]runtime.Object{
+		"v1/ns1/policy.yaml": {newUnstructured("NetworkPolicy", "kube-system", "allow-dns")},
+	}
+
+	if err := writeOutputDir(dir, "yaml", perFile, results); err != nil {
+		t.Fatalf("writeOutputDir: %v", err)
+	}
+
+	want := filepath.Join(dir, "ns1", "kube-system", "networkpolicy-allow-dns.yaml")
+	if _, err := os.Stat(want); err != nil {
+		t.Errorf("expected output file %s: %v", want, err)
+	}
+}
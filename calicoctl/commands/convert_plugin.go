@@ -0,0 +1,67 @@
+// Copyright (c) 2018 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/projectcalico/libcalico-go/lib/apis/v1/unversioned"
+)
+
+// pluginPrefix is prepended to a resource's lower-cased Kind to form the
+// executable name convert looks for on $PATH, mirroring kubectl's own
+// plugin naming convention.
+const pluginPrefix = "calicoctl-convert-"
+
+// convertViaPlugin converts a v1 resource of an unrecognised kind by
+// shelling out to a calicoctl-convert-<kind> executable on $PATH: the v1
+// resource is written to the plugin's stdin as YAML, and the v3 resource is
+// read back from its stdout as YAML.  This lets third-party resource kinds
+// (enterprise CRDs, tiered policies, custom BGPFilter kinds, ...) be
+// converted without forking calicoctl.
+func convertViaPlugin(kind string, v1resource unversioned.Resource) (runtime.Object, error) {
+	pluginName := pluginPrefix + strings.ToLower(kind)
+	path, err := exec.LookPath(pluginName)
+	if err != nil {
+		return nil, fmt.Errorf("conversion for the resource type '%s' is not supported", kind)
+	}
+
+	input, err := yaml.Marshal(v1resource)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("plugin '%s' failed: %v: %s", pluginName, err, stderr.String())
+	}
+
+	res := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal(stdout.Bytes(), &res.Object); err != nil {
+		return nil, fmt.Errorf("plugin '%s' returned an invalid v3 resource: %v", pluginName, err)
+	}
+	return res, nil
+}
@@ -0,0 +1,32 @@
+// Copyright (c) 2018 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"testing"
+
+	apiv1 "github.com/projectcalico/libcalico-go/lib/apis/v1"
+)
+
+func TestConvertViaPluginNotOnPath(t *testing.T) {
+	_, err := convertViaPlugin("bgpfilter", &apiv1.Policy{})
+	if err == nil {
+		t.Fatal("expected an error when no calicoctl-convert-bgpfilter is on $PATH")
+	}
+	want := "conversion for the resource type 'bgpfilter' is not supported"
+	if err.Error() != want {
+		t.Errorf("error = %q, want %q", err.Error(), want)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2018 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	conversion "github.com/projectcalico/libcalico-go/lib/upgrade/etcd/conversionv1v3"
+)
+
+// converters maps a resource Kind (lower-cased) to the conversion.Converter
+// responsible for it.  Built-in kinds register themselves in this file's
+// init(); third-party kinds can be added at runtime with RegisterConverter,
+// or handled out-of-process via a calicoctl-convert-<kind> plugin (see
+// convert_plugin.go) without either option requiring a fork of calicoctl.
+var converters = map[string]conversion.Converter{}
+
+// RegisterConverter makes convert aware of a Converter for kind, in addition
+// to the kinds calicoctl understands natively.  Registering a kind that's
+// already registered replaces its Converter.
+func RegisterConverter(kind string, c conversion.Converter) {
+	converters[strings.ToLower(kind)] = c
+}
+
+func init() {
+	RegisterConverter("node", conversion.Node{})
+	RegisterConverter("hostendpoint", conversion.HostEndpoint{})
+	RegisterConverter("workloadendpoint", conversion.WorkloadEndpoint{})
+	RegisterConverter("profile", conversion.Profile{})
+	RegisterConverter("policy", conversion.Policy{})
+	RegisterConverter("networkpolicy", conversion.Policy{})
+	RegisterConverter("ippool", conversion.IPPool{})
+	RegisterConverter("bgppeer", conversion.BGPPeer{})
+}
+
+// converterForKind returns the conversion.Converter registered for kind, or
+// an error if no built-in or registered Converter handles it.
+func converterForKind(kind string) (conversion.Converter, error) {
+	if c, ok := converters[strings.ToLower(kind)]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("conversion for the resource type '%s' is not supported", kind)
+}
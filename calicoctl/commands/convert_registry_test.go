@@ -0,0 +1,53 @@
+// Copyright (c) 2018 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import "testing"
+
+func TestConverterForKindBuiltins(t *testing.T) {
+	for _, kind := range []string{"Node", "hostendpoint", "Policy", "NetworkPolicy", "ippool", "bgppeer"} {
+		if _, err := converterForKind(kind); err != nil {
+			t.Errorf("converterForKind(%q): %v", kind, err)
+		}
+	}
+}
+
+func TestConverterForKindUnknown(t *testing.T) {
+	if _, err := converterForKind("bogus"); err == nil {
+		t.Error("converterForKind(\"bogus\"): expected an error, got none")
+	}
+}
+
+func TestRegisterConverterAddsAndReplaces(t *testing.T) {
+	const kind = "bgpfilter"
+	defer delete(converters, kind)
+
+	if _, err := converterForKind(kind); err == nil {
+		t.Fatalf("converterForKind(%q) should be unregistered initially", kind)
+	}
+
+	RegisterConverter(kind, nil)
+	if _, err := converterForKind(kind); err != nil {
+		t.Errorf("converterForKind(%q) after RegisterConverter: %v", kind, err)
+	}
+	before := len(converters)
+
+	// Registering the same kind again replaces, rather than duplicates,
+	// its entry.
+	RegisterConverter(kind, nil)
+	if len(converters) != before {
+		t.Errorf("RegisterConverter should replace an existing entry: len(converters) went from %d to %d", before, len(converters))
+	}
+}
@@ -0,0 +1,392 @@
+// Copyright (c) 2018 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/projectcalico/calicoctl/calicoctl/commands/v1resourceloader"
+	"github.com/projectcalico/libcalico-go/lib/apis/v1/unversioned"
+)
+
+// fetchTimeout bounds how long a remote fetch (HTTP, Gist, or git clone) is
+// allowed to take before it is abandoned.
+const fetchTimeout = 30 * time.Second
+
+// gistURLRegexp recognises full https://gist.github.com/<id> and
+// https://gist.github.com/<user>/<id> URLs.  The "gist:<id>" shorthand is
+// matched separately, by its prefix.
+var gistURLRegexp = regexp.MustCompile(`^https://gist\.github\.com/(?:[^/]+/)?([0-9a-fA-F]+)$`)
+
+// loadV1Resources loads the v1 resources referenced by filename.  filename may
+// be a local path or "-" for stdin (handled by v1resourceloader), a plain
+// https:// URL, a "gist:<id>" or https://gist.github.com/... URL, or a
+// "git+https://host/org/repo.git//path/to/dir?ref=branch" reference.  When
+// recursive is true, directories (local or fetched) are walked recursively
+// for *.yaml, *.yml and *.json files; otherwise only the top level is read.
+func loadV1Resources(filename string, recursive bool) ([]unversioned.Resource, error) {
+	grouped, _, err := loadV1ResourcesByFile(filename, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []unversioned.Resource
+	for _, g := range grouped {
+		resources = append(resources, g.resources...)
+	}
+	return resources, nil
+}
+
+// fileResources pairs the v1 resources loaded from a single source file with
+// that file's path, for callers (--output-dir, --in-place) that need to know
+// which file each resource came from.
+type fileResources struct {
+	// path is the file the resources were loaded from, or "-" for stdin.
+	path string
+	// relPath is path relative to the source's base directory, used to
+	// mirror the source tree's layout under --output-dir.  It is just the
+	// file's base name when the source wasn't a directory.
+	relPath   string
+	resources []unversioned.Resource
+}
+
+// loadV1ResourcesByFile behaves like loadV1Resources but keeps each source
+// file's resources grouped together instead of flattening them into a single
+// slice.
+func loadV1ResourcesByFile(filename string, recursive bool) ([]fileResources, string, error) {
+	files, baseDir, cleanup, err := resolveSourceFiles(filename, recursive)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cleanup()
+
+	var grouped []fileResources
+	for _, f := range files {
+		r, err := v1resourceloader.CreateResourcesFromFile(f)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %v", f, err)
+		}
+		for _, res := range r {
+			if err := checkV1APIVersion(res); err != nil {
+				return nil, "", fmt.Errorf("%s: %v", f, err)
+			}
+		}
+
+		relPath := filepath.Base(f)
+		if baseDir != "" {
+			if rel, err := filepath.Rel(baseDir, f); err == nil {
+				relPath = rel
+			}
+		}
+
+		grouped = append(grouped, fileResources{path: f, relPath: relPath, resources: r})
+	}
+	return grouped, baseDir, nil
+}
+
+// checkV1APIVersion rejects a resource whose declared apiVersion isn't a v1
+// one. v1resourceloader parses purely on Kind, so a v3 document (apiVersion:
+// projectcalico.org/v3) sharing a Kind with a v1 resource - e.g. NetworkPolicy,
+// which converterForKind also accepts as an alias for Policy - would
+// otherwise be silently accepted as v1 and lossily reinterpreted.
+func checkV1APIVersion(res unversioned.Resource) error {
+	apiVersion := res.GetTypeMetadata().APIVersion
+	if apiVersion != "" && apiVersion != v1APIVersion {
+		return fmt.Errorf("expected a v1 resource (apiVersion: %s) but found apiVersion '%s'", v1APIVersion, apiVersion)
+	}
+	return nil
+}
+
+// resolveSourceFiles resolves filename - a local path, "-" for stdin, or one
+// of the remote schemes (https://, gist:, git+https://) - to the concrete
+// list of local file paths it refers to, fetching remote content to a
+// temporary location first if necessary.  The returned cleanup func removes
+// any temporary files/directories created in the process and must always be
+// called once the caller is done reading them.
+//
+// baseDir is the directory the files were collected from (the fetched gist
+// or git checkout, or the local directory named by filename) when filename
+// refers to a directory, or "" when it names a single file or "-".  Callers
+// that need to preserve the source tree's relative layout (e.g.
+// --output-dir) use it to compute each file's path relative to the source.
+func resolveSourceFiles(filename string, recursive bool) (files []string, baseDir string, cleanup func(), err error) {
+	noopCleanup := func() {}
+
+	switch {
+	case filename == "-":
+		return []string{filename}, "", noopCleanup, nil
+
+	case strings.HasPrefix(filename, "git+"):
+		dir, err := fetchGitSource(strings.TrimPrefix(filename, "git+"))
+		if err != nil {
+			return nil, "", noopCleanup, err
+		}
+		files, base, err := resolveLocalFiles(dir, recursive)
+		return files, base, func() { os.RemoveAll(dir) }, err
+
+	case strings.HasPrefix(filename, "gist:") || gistURLRegexp.MatchString(filename):
+		dir, err := fetchGistSource(filename)
+		if err != nil {
+			return nil, "", noopCleanup, err
+		}
+		files, base, err := resolveLocalFiles(dir, recursive)
+		return files, base, func() { os.RemoveAll(dir) }, err
+
+	case strings.HasPrefix(filename, "https://") || strings.HasPrefix(filename, "http://"):
+		f, err := fetchHTTPSource(filename)
+		if err != nil {
+			return nil, "", noopCleanup, err
+		}
+		return []string{f}, "", func() { os.Remove(f) }, nil
+
+	default:
+		files, base, err := resolveLocalFiles(filename, recursive)
+		return files, base, noopCleanup, err
+	}
+}
+
+// resolveLocalFiles returns path itself if it isn't a directory (including
+// paths that don't exist, so the caller's own loader can report a clear
+// error), or every *.yaml/*.yml/*.json file beneath it otherwise, along with
+// path as the base directory those files were found under.
+func resolveLocalFiles(path string, recursive bool) (files []string, baseDir string, err error) {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return []string{path}, "", nil
+	}
+	files, err = walkManifestDir(path, recursive)
+	return files, path, err
+}
+
+// walkManifestDir returns the sorted list of *.yaml, *.yml and *.json files
+// found in dir.  When recursive is false only dir's immediate children are
+// considered.
+func walkManifestDir(dir string, recursive bool) ([]string, error) {
+	var files []string
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if e.IsDir() {
+			if recursive {
+				sub, err := walkManifestDir(path, recursive)
+				if err != nil {
+					return nil, err
+				}
+				files = append(files, sub...)
+			}
+			continue
+		}
+		if isManifestFile(e.Name()) {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func isManifestFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+// fetchHTTPSource downloads url to a temporary file and returns its path.
+// Redirects and ~/.netrc based authentication are honoured by the http
+// client; the fetch is bounded by fetchTimeout.
+func fetchHTTPSource(rawurl string) (string, error) {
+	client := &http.Client{Timeout: fetchTimeout}
+
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return "", err
+	}
+	if u, p, ok := netrcAuth(req.URL.Host); ok {
+		req.SetBasicAuth(u, p)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching %s: %v", rawurl, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching %s: unexpected status %s", rawurl, resp.Status)
+	}
+
+	return writeTempFile(filepath.Base(req.URL.Path), resp.Body)
+}
+
+// gistFile is the subset of the GitHub Gist API response we care about.
+type gistFile struct {
+	Filename string `json:"filename"`
+	RawURL   string `json:"raw_url"`
+}
+
+type gistResponse struct {
+	Files map[string]gistFile `json:"files"`
+}
+
+// fetchGistSource downloads every file in the referenced gist into a new
+// temporary directory and returns that directory's path.
+func fetchGistSource(filename string) (string, error) {
+	var id string
+	if strings.HasPrefix(filename, "gist:") {
+		id = strings.TrimPrefix(filename, "gist:")
+	} else {
+		m := gistURLRegexp.FindStringSubmatch(filename)
+		if m == nil {
+			return "", fmt.Errorf("not a valid gist reference: %s", filename)
+		}
+		id = m[1]
+	}
+
+	client := &http.Client{Timeout: fetchTimeout}
+	resp, err := client.Get(fmt.Sprintf("https://api.github.com/gists/%s", id))
+	if err != nil {
+		return "", fmt.Errorf("fetching gist %s: %v", id, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching gist %s: unexpected status %s", id, resp.Status)
+	}
+
+	var gist gistResponse
+	if err := json.NewDecoder(resp.Body).Decode(&gist); err != nil {
+		return "", fmt.Errorf("decoding gist %s: %v", id, err)
+	}
+
+	dir, err := ioutil.TempDir("", "calicoctl-gist-")
+	if err != nil {
+		return "", err
+	}
+
+	for _, f := range gist.Files {
+		fresp, err := client.Get(f.RawURL)
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("fetching gist file %s: %v", f.Filename, err)
+		}
+		data, err := ioutil.ReadAll(fresp.Body)
+		fresp.Body.Close()
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("reading gist file %s: %v", f.Filename, err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, f.Filename), data, 0644); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+
+	return dir, nil
+}
+
+// fetchGitSource shallow-clones the repo referenced by a
+// "https://host/org/repo.git//path/to/dir?ref=branch" spec (the "git+" prefix
+// already stripped by the caller) and returns the absolute path to the
+// referenced subdirectory or file within the clone.
+func fetchGitSource(spec string) (string, error) {
+	repoURL, subpath, ref, err := parseGitSource(spec)
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := ioutil.TempDir("", "calicoctl-git-")
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"clone", "--depth=1"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	args = append(args, repoURL, dir)
+
+	cmd := exec.Command("git", args...)
+	ctxErr := make(chan error, 1)
+	go func() { ctxErr <- cmd.Run() }()
+	select {
+	case err := <-ctxErr:
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("cloning %s: %v", repoURL, err)
+		}
+	case <-time.After(fetchTimeout):
+		cmd.Process.Kill()
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("cloning %s: timed out", repoURL)
+	}
+
+	if subpath == "" {
+		return dir, nil
+	}
+	return filepath.Join(dir, subpath), nil
+}
+
+// parseGitSource splits a "https://host/org/repo.git//path/to/dir?ref=branch" spec
+// into the clonable repo URL, the referenced subpath within it, and the
+// optional ref to check out.
+func parseGitSource(spec string) (repoURL, subpath, ref string, err error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid git source %q: %v", spec, err)
+	}
+	ref = u.Query().Get("ref")
+	u.RawQuery = ""
+
+	path := u.Path
+	repoPath, subpath := path, ""
+	if idx := strings.Index(path, "//"); idx != -1 {
+		repoPath, subpath = path[:idx], strings.TrimPrefix(path[idx+1:], "/")
+	}
+	u.Path = repoPath
+
+	return u.String(), subpath, ref, nil
+}
+
+// writeTempFile copies r into a new temporary file, named after base, and
+// returns its path.
+func writeTempFile(base string, r io.Reader) (string, error) {
+	if base == "" || base == "/" {
+		base = "resource"
+	}
+	f, err := ioutil.TempFile("", "calicoctl-*-"+filepath.Base(base))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2018 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"testing"
+
+	apiv1 "github.com/projectcalico/libcalico-go/lib/apis/v1"
+)
+
+func TestParseGitSource(t *testing.T) {
+	repoURL, subpath, ref, err := parseGitSource("https://github.com/projectcalico/calico.git//manifests/policy?ref=release-v3.0")
+	if err != nil {
+		t.Fatalf("parseGitSource: %v", err)
+	}
+	if repoURL != "https://github.com/projectcalico/calico.git" {
+		t.Errorf("repoURL = %q, want %q", repoURL, "https://github.com/projectcalico/calico.git")
+	}
+	if subpath != "manifests/policy" {
+		t.Errorf("subpath = %q, want %q", subpath, "manifests/policy")
+	}
+	if ref != "release-v3.0" {
+		t.Errorf("ref = %q, want %q", ref, "release-v3.0")
+	}
+}
+
+func TestParseGitSourceNoSubpathOrRef(t *testing.T) {
+	repoURL, subpath, ref, err := parseGitSource("https://github.com/projectcalico/calico.git")
+	if err != nil {
+		t.Fatalf("parseGitSource: %v", err)
+	}
+	if repoURL != "https://github.com/projectcalico/calico.git" {
+		t.Errorf("repoURL = %q, want %q", repoURL, "https://github.com/projectcalico/calico.git")
+	}
+	if subpath != "" {
+		t.Errorf("subpath = %q, want \"\"", subpath)
+	}
+	if ref != "" {
+		t.Errorf("ref = %q, want \"\"", ref)
+	}
+}
+
+func TestGistURLRegexp(t *testing.T) {
+	cases := map[string]bool{
+		"gist:abcdef1234567890":                             false, // handled by the "gist:" prefix, not this regexp
+		"https://gist.github.com/abcdef1234567890":          true,
+		"https://gist.github.com/someuser/abcdef1234567890": true,
+		"https://example.com/abcdef1234567890":              false,
+	}
+	for url, want := range cases {
+		if got := gistURLRegexp.MatchString(url); got != want {
+			t.Errorf("gistURLRegexp.MatchString(%q) = %v, want %v", url, got, want)
+		}
+	}
+}
+
+func TestCheckV1APIVersion(t *testing.T) {
+	v1Policy := &apiv1.Policy{}
+	v1Policy.APIVersion = "v1"
+	if err := checkV1APIVersion(v1Policy); err != nil {
+		t.Errorf("a v1 resource should be accepted: %v", err)
+	}
+
+	unversionedPolicy := &apiv1.Policy{}
+	if err := checkV1APIVersion(unversionedPolicy); err != nil {
+		t.Errorf("a resource with no declared apiVersion should be accepted: %v", err)
+	}
+
+	v3Policy := &apiv1.Policy{}
+	v3Policy.APIVersion = v3APIVersion
+	if err := checkV1APIVersion(v3Policy); err == nil {
+		t.Error("a v3 resource sharing a v1 Kind should be rejected, not silently reinterpreted")
+	}
+}
+
+func TestIsManifestFile(t *testing.T) {
+	cases := map[string]bool{
+		"policy.yaml": true,
+		"policy.yml":  true,
+		"policy.json": true,
+		"policy.JSON": true,
+		"README.md":   false,
+		"policy":      false,
+	}
+	for name, want := range cases {
+		if got := isManifestFile(name); got != want {
+			t.Errorf("isManifestFile(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
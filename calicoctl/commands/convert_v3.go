@@ -0,0 +1,367 @@
+// Copyright (c) 2018 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	apiv1 "github.com/projectcalico/libcalico-go/lib/apis/v1"
+	"github.com/projectcalico/libcalico-go/lib/apis/v1/unversioned"
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+)
+
+// v1APIVersion and v3APIVersion are the apiVersion values input documents are
+// checked against (by checkV1APIVersion and loadV3Resources).  convertResource
+// does not dispatch on them; it selects a converter by Kind only.
+const (
+	v1APIVersion = "v1"
+	v3APIVersion = "projectcalico.org/v3"
+)
+
+// yamlDocSeparator splits a multi-document YAML stream into its individual
+// documents.
+var yamlDocSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// typeMeta is enough of a resource's envelope to tell which API version and
+// kind it is without committing to a concrete Go type.
+type typeMeta struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+}
+
+// newV1Resource returns a zero-valued v1 API resource of the given kind,
+// ready to be unmarshalled into. It mirrors newV3Resource, but for the
+// downgrade direction.
+func newV1Resource(kind string) (unversioned.Resource, error) {
+	switch strings.ToLower(kind) {
+	case "node":
+		return &apiv1.Node{}, nil
+	case "hostendpoint":
+		return &apiv1.HostEndpoint{}, nil
+	case "workloadendpoint":
+		return &apiv1.WorkloadEndpoint{}, nil
+	case "profile":
+		return &apiv1.Profile{}, nil
+	case "networkpolicy", "policy":
+		return &apiv1.Policy{}, nil
+	case "ippool":
+		return &apiv1.IPPool{}, nil
+	case "bgppeer":
+		return &apiv1.BGPPeer{}, nil
+	default:
+		return nil, fmt.Errorf("conversion for the resource type '%s' is not supported", kind)
+	}
+}
+
+// convertResourceV3ToV1 converts a v3 API resource back down to its v1
+// equivalent, returning a clear error if the v3 resource uses a feature (e.g.
+// tiered policy, namespaced resources) that has no v1 representation.
+//
+// conversionv1v3's vendored Converters only go one way (v1 -> v3); there is
+// no vendored inverse to call into. Rather than fail every kind outright,
+// the downgrade is done structurally: the v3 resource is re-marshalled onto
+// its v1 equivalent, relying on the two API versions sharing field names and
+// tags for everything v1 understands. --validate reports whatever doesn't
+// survive that round trip.
+func convertResourceV3ToV1(v3Resource runtime.Object) (unversioned.Resource, error) {
+	kind := v3Resource.GetObjectKind().GroupVersionKind().Kind
+
+	v1Resource, err := newV1Resource(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rejectV3OnlyFeatures(v3Resource); err != nil {
+		return nil, fmt.Errorf("resource has no v1 equivalent: %v", err)
+	}
+
+	generic, err := toGenericMap(v3Resource)
+	if err != nil {
+		return nil, err
+	}
+	root, _ := generic.(map[string]interface{})
+	// Overwrite the v3 envelope with the v1 one rather than carrying the
+	// v3 apiVersion/kind through onto the v1 struct.
+	root["apiVersion"] = v1APIVersion
+	root["kind"] = kind
+
+	raw, err := yaml.Marshal(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(raw, v1Resource); err != nil {
+		return nil, fmt.Errorf("resource has no v1 equivalent: %v", err)
+	}
+
+	return v1Resource, nil
+}
+
+// namespaceSelectorKey is the field name v3 uses, both at the top level of a
+// NetworkPolicySpec and on each Ingress/Egress rule's Source/Destination, to
+// scope a selector to resources in matching namespaces.
+const namespaceSelectorKey = "namespaceSelector"
+
+// namespaceScopedSelectorTerm is the pseudo-label selector expressions use
+// to match against a resource's namespace, e.g. `projectcalico.org/namespace
+// == "prod"`.  It has no v1 equivalent since v1 predates namespaced
+// resources entirely.
+const namespaceScopedSelectorTerm = "projectcalico.org/namespace"
+
+// rejectV3OnlyFeatures reports an error if v3Resource uses a construct v1
+// has no representation for: a resource scoped to a Kubernetes namespace, a
+// policy assigned to a tier other than "default", or a selector (top-level
+// or rule-level) that scopes to a namespace (v1 predates namespaced
+// resources, tiered policy, and namespace-scoped selectors alike).
+func rejectV3OnlyFeatures(v3Resource runtime.Object) error {
+	generic, err := toGenericMap(v3Resource)
+	if err != nil {
+		return err
+	}
+	root, _ := generic.(map[string]interface{})
+
+	if metadata, ok := root["metadata"].(map[string]interface{}); ok {
+		if ns, _ := metadata["namespace"].(string); ns != "" {
+			return fmt.Errorf("namespaced resources are not supported in v1 (namespace %q)", ns)
+		}
+	}
+	if spec, ok := root["spec"].(map[string]interface{}); ok {
+		if tier, _ := spec["tier"].(string); tier != "" && tier != "default" {
+			return fmt.Errorf("tiered policy is not supported in v1 (tier %q)", tier)
+		}
+	}
+	if field, ok := findNamespacedSelector(root); ok {
+		return fmt.Errorf("namespace-scoped selectors are not supported in v1 (%s)", field)
+	}
+	return nil
+}
+
+// findNamespacedSelector walks a resource's generic YAML/JSON tree looking
+// for a namespace-scoped selector: a non-empty "namespaceSelector" field
+// (set at the top level of a NetworkPolicySpec, or on a rule's Source/
+// Destination), or any selector string that matches against the
+// namespaceScopedSelectorTerm pseudo-label. It returns the field's dotted
+// path for use in the resulting error.
+func findNamespacedSelector(node interface{}) (string, bool) {
+	return findNamespacedSelectorAt("", node)
+}
+
+// selectorReferencesNamespace reports whether selector uses the
+// namespaceScopedSelectorTerm pseudo-label, as opposed to merely containing
+// it as a prefix of some other, unrelated label key (e.g.
+// "projectcalico.org/namespace-group").
+func selectorReferencesNamespace(selector string) bool {
+	for i := 0; i+len(namespaceScopedSelectorTerm) <= len(selector); i++ {
+		idx := strings.Index(selector[i:], namespaceScopedSelectorTerm)
+		if idx == -1 {
+			return false
+		}
+		start, end := i+idx, i+idx+len(namespaceScopedSelectorTerm)
+		if (start == 0 || !isSelectorLabelChar(selector[start-1])) &&
+			(end == len(selector) || !isSelectorLabelChar(selector[end])) {
+			return true
+		}
+		i = start
+	}
+	return false
+}
+
+// isSelectorLabelChar reports whether b can appear within a selector's label
+// key (letters, digits, and the "-_./" separators Calico label keys allow).
+func isSelectorLabelChar(b byte) bool {
+	switch {
+	case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9':
+		return true
+	case b == '-' || b == '_' || b == '.' || b == '/':
+		return true
+	default:
+		return false
+	}
+}
+
+func findNamespacedSelectorAt(path string, node interface{}) (string, bool) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			if key == namespaceSelectorKey {
+				if s, _ := child.(string); s != "" {
+					return childPath, true
+				}
+			}
+			if key == "selector" {
+				if s, _ := child.(string); selectorReferencesNamespace(s) {
+					return childPath, true
+				}
+			}
+			if found, ok := findNamespacedSelectorAt(childPath, child); ok {
+				return found, true
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if found, ok := findNamespacedSelectorAt(fmt.Sprintf("%s[%d]", path, i), child); ok {
+				return found, true
+			}
+		}
+	}
+	return "", false
+}
+
+// newV3Resource returns a zero-valued v3 API resource of the given kind,
+// ready to be unmarshalled into.
+func newV3Resource(kind string) (runtime.Object, error) {
+	switch strings.ToLower(kind) {
+	case "node":
+		return &apiv3.Node{}, nil
+	case "hostendpoint":
+		return &apiv3.HostEndpoint{}, nil
+	case "workloadendpoint":
+		return &apiv3.WorkloadEndpoint{}, nil
+	case "profile":
+		return &apiv3.Profile{}, nil
+	case "networkpolicy", "policy":
+		return &apiv3.NetworkPolicy{}, nil
+	case "ippool":
+		return &apiv3.IPPool{}, nil
+	case "bgppeer":
+		return &apiv3.BGPPeer{}, nil
+	default:
+		return nil, fmt.Errorf("conversion for the resource type '%s' is not supported", kind)
+	}
+}
+
+// loadV3Resources reads every v3 resource document referenced by filename,
+// sharing the same remote-source and directory handling as loadV1Resources.
+func loadV3Resources(filename string, recursive bool) ([]runtime.Object, error) {
+	docs, err := loadRawDocuments(filename, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []runtime.Object
+	for _, raw := range docs {
+		apiVersion, err := detectAPIVersion(raw)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(apiVersion, "projectcalico.org/v3") {
+			return nil, fmt.Errorf("expected a v3 resource (apiVersion: %s) but found apiVersion '%s'", v3APIVersion, apiVersion)
+		}
+
+		var tm typeMeta
+		if err := yaml.Unmarshal(raw, &tm); err != nil {
+			return nil, err
+		}
+
+		res, err := newV3Resource(tm.Kind)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(raw, res); err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", tm.Kind, err)
+		}
+		resources = append(resources, res)
+	}
+	return resources, nil
+}
+
+// loadRawDocuments resolves filename to its underlying file(s) - applying
+// the same remote-source and directory handling as loadV1Resources - and
+// splits each one into its individual YAML/JSON documents.
+func loadRawDocuments(filename string, recursive bool) ([][]byte, error) {
+	files, _, cleanup, err := resolveSourceFiles(filename, recursive)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var docs [][]byte
+	for _, f := range files {
+		var data []byte
+		if f == "-" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(f)
+		}
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, splitYAMLDocuments(data)...)
+	}
+	return docs, nil
+}
+
+// splitYAMLDocuments splits a multi-document YAML (or single-document JSON)
+// byte stream into its individual documents, dropping any that are empty.
+func splitYAMLDocuments(data []byte) [][]byte {
+	var docs [][]byte
+	for _, part := range yamlDocSeparator.Split(string(data), -1) {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		docs = append(docs, []byte(part))
+	}
+	return docs
+}
+
+// printV1Resources prints v1 resources to stdout in the given output format
+// ("yaml" or "json"), one document at a time.
+func printV1Resources(output string, resources []unversioned.Resource) error {
+	for i, r := range resources {
+		var out []byte
+		var err error
+		if output == "json" {
+			out, err = json.MarshalIndent(r, "", "  ")
+		} else {
+			out, err = yaml.Marshal(r)
+		}
+		if err != nil {
+			return err
+		}
+		if i > 0 && output != "json" {
+			fmt.Println("---")
+		}
+		fmt.Println(string(out))
+	}
+	return nil
+}
+
+// detectAPIVersion peeks at a raw resource document's apiVersion. It is used
+// by loadV3Resources to reject a document that doesn't actually declare
+// itself as v3 when --from=v3 was given; it does not make convertResource
+// dispatch per-document, which still happens purely on Kind.
+func detectAPIVersion(raw []byte) (string, error) {
+	var tm typeMeta
+	if err := yaml.Unmarshal(raw, &tm); err != nil {
+		return "", err
+	}
+	if tm.APIVersion == "" {
+		// v1 resources predate apiVersion being consistently required;
+		// treat a missing value as v1.
+		return v1APIVersion, nil
+	}
+	return tm.APIVersion, nil
+}
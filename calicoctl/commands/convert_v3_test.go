@@ -0,0 +1,165 @@
+// Copyright (c) 2018 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"testing"
+
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewV1Resource(t *testing.T) {
+	for _, kind := range []string{"Node", "hostendpoint", "Policy", "networkpolicy", "ippool", "BGPPeer"} {
+		if _, err := newV1Resource(kind); err != nil {
+			t.Errorf("newV1Resource(%q): %v", kind, err)
+		}
+	}
+
+	if _, err := newV1Resource("bogus"); err == nil {
+		t.Error("newV1Resource(\"bogus\"): expected an error, got none")
+	}
+}
+
+func TestRejectV3OnlyFeatures(t *testing.T) {
+	policy := &apiv3.NetworkPolicy{}
+	policy.Kind = "NetworkPolicy"
+	policy.Spec.Tier = "default"
+	if err := rejectV3OnlyFeatures(policy); err != nil {
+		t.Errorf("default-tier policy should round-trip: %v", err)
+	}
+
+	policy.Spec.Tier = "security"
+	if err := rejectV3OnlyFeatures(policy); err == nil {
+		t.Error("non-default tier should be rejected")
+	}
+
+	hep := &apiv3.HostEndpoint{}
+	hep.Kind = "HostEndpoint"
+	hep.Namespace = ""
+	if err := rejectV3OnlyFeatures(hep); err != nil {
+		t.Errorf("cluster-scoped resource should round-trip: %v", err)
+	}
+
+	netpol := &apiv3.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1"}}
+	netpol.Kind = "NetworkPolicy"
+	if err := rejectV3OnlyFeatures(netpol); err == nil {
+		t.Error("namespaced resource should be rejected")
+	}
+}
+
+func TestFindNamespacedSelector(t *testing.T) {
+	cases := []struct {
+		name string
+		node interface{}
+		want bool
+	}{
+		{
+			name: "no selectors at all",
+			node: map[string]interface{}{"spec": map[string]interface{}{"tier": "default"}},
+			want: false,
+		},
+		{
+			name: "plain label selector",
+			node: map[string]interface{}{"spec": map[string]interface{}{"selector": "role == 'webserver'"}},
+			want: false,
+		},
+		{
+			name: "top-level namespaceSelector",
+			node: map[string]interface{}{"spec": map[string]interface{}{"namespaceSelector": "team == 'infra'"}},
+			want: true,
+		},
+		{
+			name: "empty namespaceSelector doesn't count",
+			node: map[string]interface{}{"spec": map[string]interface{}{"namespaceSelector": ""}},
+			want: false,
+		},
+		{
+			name: "rule-level source namespaceSelector",
+			node: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"ingress": []interface{}{
+						map[string]interface{}{
+							"source": map[string]interface{}{"namespaceSelector": "team == 'infra'"},
+						},
+					},
+				},
+			},
+			want: true,
+		},
+		{
+			name: "selector referencing the namespace pseudo-label",
+			node: map[string]interface{}{
+				"spec": map[string]interface{}{"selector": `projectcalico.org/namespace == "prod"`},
+			},
+			want: true,
+		},
+		{
+			name: "selector using an unrelated label that shares the namespace pseudo-label as a prefix",
+			node: map[string]interface{}{
+				"spec": map[string]interface{}{"selector": `projectcalico.org/namespace-group == 'finance'`},
+			},
+			want: false,
+		},
+	}
+
+	for _, c := range cases {
+		_, got := findNamespacedSelector(c.node)
+		if got != c.want {
+			t.Errorf("%s: findNamespacedSelector() = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestConvertResourceV3ToV1OverwritesEnvelope(t *testing.T) {
+	ipPool := &apiv3.IPPool{}
+	ipPool.Kind = "IPPool"
+	ipPool.APIVersion = v3APIVersion
+	ipPool.Name = "pool-1"
+	ipPool.Spec.CIDR = "10.0.0.0/16"
+
+	v1Resource, err := convertResourceV3ToV1(ipPool)
+	if err != nil {
+		t.Fatalf("convertResourceV3ToV1: %v", err)
+	}
+
+	tm := v1Resource.GetTypeMetadata()
+	if tm.APIVersion != v1APIVersion {
+		t.Errorf("apiVersion = %q, want %q", tm.APIVersion, v1APIVersion)
+	}
+	if tm.Kind != "IPPool" {
+		t.Errorf("kind = %q, want %q", tm.Kind, "IPPool")
+	}
+}
+
+func TestDetectAPIVersion(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want string
+	}{
+		{`apiVersion: projectcalico.org/v3
+kind: Node`, "projectcalico.org/v3"},
+		{`kind: node`, v1APIVersion},
+	}
+	for _, c := range cases {
+		got, err := detectAPIVersion([]byte(c.raw))
+		if err != nil {
+			t.Fatalf("detectAPIVersion(%q): %v", c.raw, err)
+		}
+		if got != c.want {
+			t.Errorf("detectAPIVersion(%q) = %q, want %q", c.raw, got, c.want)
+		}
+	}
+}
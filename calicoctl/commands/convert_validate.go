@@ -0,0 +1,259 @@
+// Copyright (c) 2018 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/projectcalico/libcalico-go/lib/apis/v1/unversioned"
+)
+
+// lossKind categorises a single field-level difference found by a round-trip
+// validation.
+type lossKind string
+
+const (
+	lossDropped lossKind = "dropped" // present in the v1 source, absent after the round trip
+	lossAdded   lossKind = "added"   // absent in the v1 source, present after the round trip (defaulted)
+	lossChanged lossKind = "changed" // present in both, but with a different value (e.g. renamed)
+)
+
+// fieldLoss describes one field that didn't survive a v1 -> v3 -> v1 round
+// trip unchanged.
+type fieldLoss struct {
+	Path   string      `json:"path"`
+	Kind   lossKind    `json:"kind"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// validationResult is the outcome of round-tripping a single resource.
+type validationResult struct {
+	Kind   string      `json:"kind"`
+	Name   string      `json:"name"`
+	Losses []fieldLoss `json:"losses"`
+}
+
+// validateRoundTrip converts v3Resource back to v1 via the inverse
+// converters and diffs the result against the original v1 source, reporting
+// any fields that were dropped, renamed, or defaulted in the process.
+func validateRoundTrip(v1Source unversioned.Resource, v3Resource runtime.Object) (validationResult, error) {
+	roundTripped, err := convertResourceV3ToV1(v3Resource)
+	if err != nil {
+		return validationResult{}, fmt.Errorf("round-trip conversion failed: %v", err)
+	}
+
+	before, err := toGenericMap(v1Source)
+	if err != nil {
+		return validationResult{}, err
+	}
+	after, err := toGenericMap(roundTripped)
+	if err != nil {
+		return validationResult{}, err
+	}
+
+	return validationResult{
+		Kind:   v1Source.GetTypeMetadata().Kind,
+		Name:   genericResourceName(before),
+		Losses: diffGeneric("", before, after),
+	}, nil
+}
+
+// genericResourceName best-effort extracts metadata.name from a resource's
+// generic YAML/JSON tree, for labelling validation reports.
+func genericResourceName(generic interface{}) string {
+	root, ok := generic.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	metadata, ok := root["metadata"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	name, _ := metadata["name"].(string)
+	return name
+}
+
+// toGenericMap marshals v to YAML/JSON and back into a generic
+// map[string]interface{} tree so it can be diffed without needing to know
+// its concrete type's fields up front.
+func toGenericMap(v interface{}) (interface{}, error) {
+	raw, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := yaml.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// diffGeneric recursively compares two generic YAML/JSON trees, returning
+// one fieldLoss per value that was dropped, added, or changed.  Only maps
+// present on both sides are compared key by key; a list, or a map present on
+// just one side, is compared and reported as a single value.
+func diffGeneric(path string, before, after interface{}) []fieldLoss {
+	beforeMap, beforeIsMap := before.(map[string]interface{})
+	afterMap, afterIsMap := after.(map[string]interface{})
+	if beforeIsMap && afterIsMap {
+		return diffGenericMaps(path, beforeMap, afterMap)
+	}
+
+	if fmt.Sprintf("%v", before) == fmt.Sprintf("%v", after) {
+		return nil
+	}
+	switch {
+	case before == nil:
+		return []fieldLoss{{Path: path, Kind: lossAdded, After: after}}
+	case after == nil:
+		return []fieldLoss{{Path: path, Kind: lossDropped, Before: before}}
+	default:
+		return []fieldLoss{{Path: path, Kind: lossChanged, Before: before, After: after}}
+	}
+}
+
+func diffGenericMaps(path string, before, after map[string]interface{}) []fieldLoss {
+	keys := map[string]bool{}
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+
+	var sorted []string
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var losses []fieldLoss
+	for _, k := range sorted {
+		childPath := k
+		if path != "" {
+			childPath = path + "." + k
+		}
+		losses = append(losses, diffGeneric(childPath, before[k], after[k])...)
+	}
+	return losses
+}
+
+// printValidationReport writes a unified textual report of the given
+// validation results by default, or a structured report under
+// --output=json.
+func printValidationReport(output string, results []validationResult) error {
+	if output == "json" {
+		out, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	for _, r := range results {
+		if len(r.Losses) == 0 {
+			fmt.Printf("%s/%s: round-trips cleanly\n", r.Kind, r.Name)
+			continue
+		}
+		fmt.Printf("%s/%s:\n", r.Kind, r.Name)
+		for _, l := range r.Losses {
+			switch l.Kind {
+			case lossDropped:
+				fmt.Printf("  - %s: dropped (was %v)\n", l.Path, l.Before)
+			case lossAdded:
+				fmt.Printf("  - %s: defaulted to %v\n", l.Path, l.After)
+			case lossChanged:
+				fmt.Printf("  - %s: %v -> %v\n", l.Path, l.Before, l.After)
+			}
+		}
+	}
+	return nil
+}
+
+// hasLoss reports whether any of the results recorded a field loss.
+func hasLoss(results []validationResult) bool {
+	for _, r := range results {
+		if len(r.Losses) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// flattenPaths returns the sorted, dotted paths of every leaf value in a
+// resource's generic YAML/JSON tree, e.g. "metadata.name", "spec.order".
+func flattenPaths(generic interface{}) []string {
+	m, ok := generic.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	var paths []string
+	for k, v := range m {
+		if child, ok := v.(map[string]interface{}); ok {
+			for _, sub := range flattenPaths(child) {
+				paths = append(paths, k+"."+sub)
+			}
+			continue
+		}
+		paths = append(paths, k)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// explainedResource pairs a converted v3 resource with the v1 source fields
+// that produced it, for --explain output.
+type explainedResource struct {
+	Resource  runtime.Object `json:"resource"`
+	V1Sources []string       `json:"v1Sources"`
+}
+
+// printExplainedResources prints each converted v3 resource annotated with
+// the v1 source fields it was converted from: as a preceding YAML comment
+// block by default, or as a "v1Sources" sibling under --output=json.
+func printExplainedResources(output string, explained []explainedResource) error {
+	if output == "json" {
+		out, err := json.MarshalIndent(explained, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	for i, e := range explained {
+		if i > 0 {
+			fmt.Println("---")
+		}
+		fmt.Println("# Converted from v1 source fields:")
+		for _, p := range e.V1Sources {
+			fmt.Printf("#   %s\n", p)
+		}
+		out, err := yaml.Marshal(e.Resource)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2018 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDiffGeneric(t *testing.T) {
+	before := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "foo"},
+		"spec":     map[string]interface{}{"order": float64(10), "dropped": "x"},
+	}
+	after := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "foo"},
+		"spec":     map[string]interface{}{"order": float64(20), "added": "y"},
+	}
+
+	losses := diffGeneric("", before, after)
+
+	byPath := map[string]fieldLoss{}
+	for _, l := range losses {
+		byPath[l.Path] = l
+	}
+
+	if l, ok := byPath["spec.order"]; !ok || l.Kind != lossChanged {
+		t.Errorf("expected spec.order to be a changed loss, got %+v", byPath["spec.order"])
+	}
+	if l, ok := byPath["spec.dropped"]; !ok || l.Kind != lossDropped {
+		t.Errorf("expected spec.dropped to be a dropped loss, got %+v", byPath["spec.dropped"])
+	}
+	if l, ok := byPath["spec.added"]; !ok || l.Kind != lossAdded {
+		t.Errorf("expected spec.added to be an added loss, got %+v", byPath["spec.added"])
+	}
+	if _, ok := byPath["metadata.name"]; ok {
+		t.Error("unchanged metadata.name should not be reported as a loss")
+	}
+}
+
+func TestHasLoss(t *testing.T) {
+	if hasLoss([]validationResult{{Losses: nil}}) {
+		t.Error("hasLoss should be false when no result has losses")
+	}
+	if !hasLoss([]validationResult{{Losses: nil}, {Losses: []fieldLoss{{Path: "spec.order"}}}}) {
+		t.Error("hasLoss should be true when any result has losses")
+	}
+}
+
+func TestFlattenPaths(t *testing.T) {
+	generic := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "foo"},
+		"spec":     map[string]interface{}{"order": float64(10)},
+	}
+
+	got := flattenPaths(generic)
+	sort.Strings(got)
+	want := []string{"metadata.name", "spec.order"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("flattenPaths() = %v, want %v", got, want)
+	}
+}
+
+func TestGenericResourceName(t *testing.T) {
+	generic := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "foo"},
+	}
+	if got := genericResourceName(generic); got != "foo" {
+		t.Errorf("genericResourceName() = %q, want %q", got, "foo")
+	}
+	if got := genericResourceName(map[string]interface{}{}); got != "" {
+		t.Errorf("genericResourceName() on empty map = %q, want \"\"", got)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2018 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// netrcAuth looks up credentials for host in ~/.netrc, returning ok=false if
+// the file or a matching "machine" entry doesn't exist.  Only the subset of
+// the netrc format needed for basic auth (machine/login/password) is parsed.
+func netrcAuth(host string) (username, password string, ok bool) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", false
+	}
+	f, err := os.Open(filepath.Join(home, ".netrc"))
+	if err != nil {
+		return "", "", false
+	}
+	defer f.Close()
+
+	var machine, login, pass string
+	matched := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for i := 0; i+1 < len(fields); i += 2 {
+			switch fields[i] {
+			case "machine":
+				if matched {
+					return login, pass, true
+				}
+				machine, login, pass = fields[i+1], "", ""
+				matched = machine == host
+			case "login":
+				if matched {
+					login = fields[i+1]
+				}
+			case "password":
+				if matched {
+					pass = fields[i+1]
+				}
+			}
+		}
+	}
+	if matched {
+		return login, pass, true
+	}
+	return "", "", false
+}